@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	dep "github.com/hashicorp/consul-template/dependency"
 	"github.com/hashicorp/consul-template/logging"
@@ -64,14 +65,22 @@ func (cli *CLI) Run(args []string) int {
 		return cli.handleError(err, ExitCodeParseFlagsError)
 	}
 
-	// Setup the logging
-	if err := logging.Setup(&logging.Config{
-		Name:           Name,
-		Level:          config.LogLevel,
-		Syslog:         config.Syslog.Enabled,
-		SyslogFacility: config.Syslog.Facility,
-		Writer:         cli.errStream,
-	}); err != nil {
+	// Preserve a copy of the flag-derived config before it is ever merged
+	// with anything from disk. A SIGHUP re-reads config.Path and merges it
+	// underneath this copy, so CLI flags continue to win after a reload.
+	baseConfig := config.Copy()
+
+	// Load config.Path, if given, before the first runner ever starts - not
+	// just on a later SIGHUP - so prefix{}/vault{}/secret{}/etc. stanzas in
+	// the file take effect on initial startup too. This also runs cli.setup,
+	// so a file-provided log_level applies from the start.
+	if config.Path != "" {
+		newConfig, err := cli.reload(baseConfig)
+		if err != nil {
+			return cli.handleError(err, ExitCodeParseConfigError)
+		}
+		config = newConfig
+	} else if err := cli.setup(config); err != nil {
 		return cli.handleError(err, ExitCodeLoggingError)
 	}
 
@@ -102,7 +111,7 @@ func (cli *CLI) Run(args []string) int {
 		if err != nil {
 			return cli.handleError(err, ExitCodeError)
 		}
-		config.Prefixes = append(config.Prefixes, prefix)
+		config.Prefixes = append(config.Prefixes, &ConfigPrefix{Dependency: prefix})
 	}
 
 	// Initial runner
@@ -133,14 +142,40 @@ func (cli *CLI) Run(args []string) int {
 				return cli.handleError(err, code)
 			}
 		case s := <-signalCh:
-			// Propogate the signal to the child process
-			runner.Signal(s)
-
 			switch s {
+			case syscall.SIGHUP:
+				fmt.Fprintf(cli.errStream, "Received HUP, reloading configuration...\n")
+
+				newConfig, err := cli.reload(baseConfig)
+				if err != nil {
+					log.Printf("[ERR] (cli) %s", err)
+					continue
+				}
+
+				if !configRequiresRestart(config, newConfig) {
+					// Nothing the runner watches or acts on changed (e.g.
+					// only log_level changed); cli.reload already applied
+					// logging live, so just swap in the new config without
+					// killing the child.
+					config = newConfig
+					runner.config = config
+					continue
+				}
+
+				config = newConfig
+
+				runner.Stop()
+				runner, err = NewRunner(config, command, once)
+				if err != nil {
+					return cli.handleError(err, ExitCodeRunnerError)
+				}
+				go runner.Start()
 			case syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
 				fmt.Fprintf(cli.errStream, "Received interrupt, cleaning up...\n")
-				runner.Stop()
-				return ExitCodeInterrupt
+				return cli.interrupt(runner, config, signalCh)
+			default:
+				// Propogate any other signal to the child process
+				runner.Signal(s)
 			}
 		case <-cli.stopCh:
 			return ExitCodeOK
@@ -148,6 +183,53 @@ func (cli *CLI) Run(args []string) int {
 	}
 }
 
+// interrupt performs a graceful shutdown of the child process: it sends
+// config.KillSignal and gives the child up to config.KillTimeout overall
+// to exit on its own, mirroring Consul agent's gracefulTimeout. Whichever
+// happens first - the child exiting, the timer expiring, or a second
+// interrupt arriving - wins; the timer and the second interrupt both
+// escalate to an immediate SIGKILL via runner.Stop().
+//
+// If a pre-exit hook is configured (PreExitCommand or PreExitDelay), it
+// runs concurrently with that wait and, once done, cuts the wait short -
+// the same way the child exiting early does. Without one configured, the
+// wait ends only when the child exits, the timer expires, or a second
+// interrupt arrives.
+func (cli *CLI) interrupt(runner *Runner, config *Config, signalCh <-chan os.Signal) int {
+	runner.Signal(config.KillSignal)
+
+	var preExitDone chan struct{}
+	if config.PreExitDelay > 0 || config.PreExitCommand != "" {
+		preExitDone = make(chan struct{})
+		go func() {
+			if err := runner.PreExit(config); err != nil {
+				log.Printf("[WARN] (cli) pre-exit hook: %s", err)
+			}
+			close(preExitDone)
+		}()
+	}
+
+	timer := time.NewTimer(config.KillTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-runner.ExitCh:
+		runner.Stop()
+		return ExitCodeInterrupt
+	case <-preExitDone:
+		runner.Stop()
+		return ExitCodeInterrupt
+	case <-timer.C:
+		fmt.Fprintf(cli.errStream, "Timed out waiting for application to stop, killing...\n")
+		runner.Stop()
+		return ExitCodeInterrupt
+	case <-signalCh:
+		fmt.Fprintf(cli.errStream, "Received another interrupt, killing...\n")
+		runner.Stop()
+		return ExitCodeInterrupt
+	}
+}
+
 // stop is used internally to shutdown a running CLI
 func (cli *CLI) stop() {
 	cli.Lock()
@@ -161,6 +243,41 @@ func (cli *CLI) stop() {
 	cli.stopped = true
 }
 
+// setup configures logging from the given config. It is called once on
+// startup and again on every SIGHUP-triggered reload so that log level and
+// syslog facility can be changed without restarting the process.
+func (cli *CLI) setup(config *Config) error {
+	return logging.Setup(&logging.Config{
+		Name:           Name,
+		Level:          config.LogLevel,
+		Syslog:         config.Syslog.Enabled,
+		SyslogFacility: config.Syslog.Facility,
+		Writer:         cli.errStream,
+	})
+}
+
+// reload re-parses the config file at baseConfig.Path (if one was given)
+// and merges baseConfig on top of it, so flags always take precedence over
+// whatever is on disk. It also re-runs setup so logging picks up any
+// changes.
+func (cli *CLI) reload(baseConfig *Config) (*Config, error) {
+	config := baseConfig.Copy()
+
+	if baseConfig.Path != "" {
+		fileConfig, err := ConfigFromPath(baseConfig.Path)
+		if err != nil {
+			return nil, fmt.Errorf("cli: error reloading config: %s", err)
+		}
+		config = fileConfig.Merge(baseConfig)
+	}
+
+	if err := cli.setup(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
 // parseFlags is a helper function for parsing command line flags using Go's
 // Flag library. This is extracted into a helper to keep the main function
 // small, but it also makes writing tests for parsing command line arguments
@@ -186,10 +303,25 @@ func (cli *CLI) parseFlags(args []string) (*Config, []string, bool, bool, error)
 	flags.Var((*watch.WaitVar)(config.Wait), "wait", "")
 	flags.DurationVar(&config.Retry, "retry", config.Retry, "")
 	flags.Var((*prefixVar)(&config.Prefixes), "prefix", "")
+	flags.Var((*secretVar)(&config.Secrets), "secret", "")
+	flags.StringVar(&config.Vault.Address, "vault-addr", config.Vault.Address, "")
+	flags.StringVar(&config.Vault.Token, "vault-token", config.Vault.Token, "")
+	flags.StringVar(&config.Vault.TokenFile, "vault-token-file", config.Vault.TokenFile, "")
+	flags.BoolVar(&config.Vault.RenewToken, "vault-renew-token", config.Vault.RenewToken, "")
+	flags.BoolVar(&config.Vault.UnwrapToken, "vault-unwrap-token", config.Vault.UnwrapToken, "")
+	flags.BoolVar(&config.Vault.SSL.Enabled, "vault-ssl", config.Vault.SSL.Enabled, "")
+	flags.BoolVar(&config.Vault.SSL.Verify, "vault-ssl-verify", config.Vault.SSL.Verify, "")
 	flags.BoolVar(&config.Sanitize, "sanitize", config.Sanitize, "")
 	flags.BoolVar(&config.Upcase, "upcase", config.Upcase, "")
 	flags.StringVar(&config.Path, "config", config.Path, "")
 	flags.StringVar(&config.LogLevel, "log-level", config.LogLevel, "")
+	flags.Var(newSignalVar(&config.KillSignal), "kill-signal", "")
+	flags.DurationVar(&config.KillTimeout, "kill-timeout", config.KillTimeout, "")
+	flags.DurationVar(&config.PreExitDelay, "pre-exit-delay", config.PreExitDelay, "")
+	flags.StringVar(&config.PreExitCommand, "pre-exit-command", config.PreExitCommand, "")
+	flags.StringVar(&config.Format, "format", config.Format, "")
+	flags.StringVar(&config.Output, "output", config.Output, "")
+	flags.StringVar(&config.PidFile, "pid-file", config.PidFile, "")
 	flags.BoolVar(&once, "once", false, "")
 	flags.BoolVar(&version, "version", false, "")
 
@@ -239,16 +371,58 @@ Options:
 
   -prefix                  A prefix to watch, multiple prefixes are merged from
                            left to right, with the right-most result taking
-                           precedence
+                           precedence. Append ":<signal>" (e.g.
+                           "app/config:SIGHUP") to send <signal> to the
+                           child on update instead of restarting it; use
+                           ":SIGNULL" for an observer prefix that should
+                           never restart or signal the child
   -sanitize                Replace invalid characters in keys to underscores
   -upcase                  Convert all environment variable keys to uppercase
 
+  -secret=<path>           A Vault KV v1/v2 path to watch, multiple secrets
+                           are merged left to right and applied on top of
+                           every -prefix, so a secret can override a
+                           Consul value
+  -vault-addr=<address>    Sets the address of the Vault instance
+  -vault-token=<token>     Sets the Vault API token
+  -vault-token-file=<path> Sets the path to a file containing a Vault token
+  -vault-renew-token       Keep the Vault token alive for the life of the
+                           process
+  -vault-unwrap-token      Treat the Vault token as a response-wrapped
+                           token to be unwrapped before use
+  -vault-ssl               Use SSL when connecting to Vault
+  -vault-ssl-verify        Verify certificates when connecting to Vault via
+                           SSL
 
   -config=<path>           Sets the path to a configuration file on disk
 
   -log-level=<level>       Set the logging level - valid values are "debug",
                            "info", "warn" (default), and "err"
 
+  -kill-signal=<signal>    Signal sent to the child on the first interrupt,
+                           giving it kill_timeout to exit cleanly before
+                           envconsul force-kills it (default SIGTERM)
+  -kill-timeout=<duration> How long to wait after kill_signal before
+                           force-killing the child (default 5s). A second
+                           interrupt forces the kill immediately
+  -pre-exit-delay=<dur>    After kill_signal, sleep this long (at most
+                           kill_timeout) before force-killing the child,
+                           giving it time to drain in-flight work. Ignored
+                           if -pre-exit-command is set
+  -pre-exit-command=<cmd>  After kill_signal, run this command (inheriting
+                           the rendered environment) and wait for it to
+                           finish before force-killing the child
+
+  -format=<format>         How to deliver the merged environment - "exec"
+                           (default) spawns and signals/restarts a child
+                           process; "dotenv", "json", and "shell" instead
+                           write a snapshot and never spawn a child
+  -output=<path>           Path the non-exec formats write their snapshot
+                           to (default stdout)
+  -pid-file=<path>         For non-exec formats, a file containing the pid
+                           to send a prefix's change_signal to, since there
+                           is no child to signal directly
+
   -once                    Do not run the process as a daemon
   -version                 Print the version of this daemon
 `
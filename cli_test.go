@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestCLI() *CLI {
+	return NewCLI(&bytes.Buffer{}, &bytes.Buffer{})
+}
+
+func TestCLI_interrupt_timesOutToKillTimeout(t *testing.T) {
+	cli := newTestCLI()
+	runner := &Runner{ExitCh: make(chan int)}
+	config := &Config{KillSignal: syscall.SIGTERM, KillTimeout: 20 * time.Millisecond}
+	signalCh := make(chan os.Signal)
+
+	start := time.Now()
+	code := cli.interrupt(runner, config, signalCh)
+	elapsed := time.Since(start)
+
+	if code != ExitCodeInterrupt {
+		t.Errorf("interrupt() = %d, want %d", code, ExitCodeInterrupt)
+	}
+	if elapsed < config.KillTimeout {
+		t.Errorf("interrupt() returned after %s, want at least kill_timeout (%s)", elapsed, config.KillTimeout)
+	}
+}
+
+func TestCLI_interrupt_childExitingWinsOverTimeout(t *testing.T) {
+	cli := newTestCLI()
+	runner := &Runner{ExitCh: make(chan int, 1)}
+	config := &Config{KillSignal: syscall.SIGTERM, KillTimeout: time.Minute}
+	signalCh := make(chan os.Signal)
+
+	runner.ExitCh <- ExitCodeOK
+
+	done := make(chan int, 1)
+	go func() { done <- cli.interrupt(runner, config, signalCh) }()
+
+	select {
+	case code := <-done:
+		if code != ExitCodeInterrupt {
+			t.Errorf("interrupt() = %d, want %d", code, ExitCodeInterrupt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("interrupt() did not return promptly when the child had already exited")
+	}
+}
+
+func TestCLI_interrupt_secondSignalWinsOverTimeout(t *testing.T) {
+	cli := newTestCLI()
+	runner := &Runner{ExitCh: make(chan int)}
+	config := &Config{KillSignal: syscall.SIGTERM, KillTimeout: time.Minute}
+	signalCh := make(chan os.Signal, 1)
+
+	signalCh <- syscall.SIGINT
+
+	done := make(chan int, 1)
+	go func() { done <- cli.interrupt(runner, config, signalCh) }()
+
+	select {
+	case code := <-done:
+		if code != ExitCodeInterrupt {
+			t.Errorf("interrupt() = %d, want %d", code, ExitCodeInterrupt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("interrupt() did not return promptly on a second interrupt")
+	}
+}
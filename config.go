@@ -0,0 +1,597 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/consul-template/signals"
+	"github.com/hashicorp/consul-template/watch"
+	"github.com/hashicorp/hcl"
+)
+
+// defaultKillSignal is the signal sent to the child on the first
+// SIGINT/SIGTERM/SIGQUIT, mirroring Consul agent's graceful shutdown.
+var defaultKillSignal os.Signal = syscall.SIGTERM
+
+// defaultKillTimeout is how long the child is given to exit on its own
+// after defaultKillSignal before envconsul escalates to SIGKILL.
+const defaultKillTimeout = 5 * time.Second
+
+// SSLConfig is used to configure SSL options for connecting to Consul.
+type SSLConfig struct {
+	Enabled bool
+	Verify  bool
+}
+
+// SyslogConfig is used to configure syslog options.
+type SyslogConfig struct {
+	Enabled  bool
+	Facility string
+}
+
+// VaultConfig configures access to Vault for the -secret/secret{} KV
+// sources, parallel to how Consul is configured for prefixes.
+type VaultConfig struct {
+	Address string
+	Token   string
+
+	// TokenFile is read if Token is not set directly, each time a Runner is
+	// built: at startup, and on a SIGHUP whose new config makes the Runner
+	// restart. A SIGHUP that leaves the Runner in place does not re-read it.
+	TokenFile string
+
+	// RenewToken keeps Token alive for the lifetime of the process.
+	RenewToken bool
+
+	// UnwrapToken treats Token as a wrapped token to be unwrapped before
+	// use, per Vault's response wrapping feature.
+	UnwrapToken bool
+
+	SSL *SSLConfig
+}
+
+// Copy returns a deep copy of this VaultConfig.
+func (c *VaultConfig) Copy() *VaultConfig {
+	if c == nil {
+		return nil
+	}
+
+	n := &VaultConfig{
+		Address:     c.Address,
+		Token:       c.Token,
+		TokenFile:   c.TokenFile,
+		RenewToken:  c.RenewToken,
+		UnwrapToken: c.UnwrapToken,
+	}
+	if c.SSL != nil {
+		ssl := *c.SSL
+		n.SSL = &ssl
+	}
+	return n
+}
+
+// Merge layers the non-zero-value fields of o on top of c, returning a new
+// VaultConfig. Like Config.Merge, o.SSL only counts as set when it differs
+// from DefaultConfig's {Verify: true}.
+func (c *VaultConfig) Merge(o *VaultConfig) *VaultConfig {
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+	if o.Address != "" {
+		r.Address = o.Address
+	}
+	if o.Token != "" {
+		r.Token = o.Token
+	}
+	if o.TokenFile != "" {
+		r.TokenFile = o.TokenFile
+	}
+	if o.RenewToken {
+		r.RenewToken = o.RenewToken
+	}
+	if o.UnwrapToken {
+		r.UnwrapToken = o.UnwrapToken
+	}
+	if o.SSL != nil && (o.SSL.Enabled || !o.SSL.Verify) {
+		r.SSL = o.SSL
+	}
+
+	return r
+}
+
+// Config is used to configure envconsul. Fields are populated first from a
+// config file (if any) and then overlaid with command line flags, which
+// win wherever they are set; see Merge for how an unset flag is told apart
+// from a set one.
+type Config struct {
+	// Path is the path to the config file this Config was parsed from, if
+	// any. It is preserved (even though it has no HCL key of its own) so
+	// that a SIGHUP can re-read the same file.
+	Path string
+
+	Consul string
+	Token  string
+	Auth   *Authentication
+	SSL    *SSLConfig
+
+	MaxStale time.Duration
+
+	Syslog *SyslogConfig
+
+	Wait  *watch.Wait
+	Retry time.Duration
+
+	Prefixes []*ConfigPrefix
+
+	Vault   *VaultConfig
+	Secrets []*ConfigSecret
+
+	Sanitize bool
+	Upcase   bool
+
+	LogLevel string
+
+	// KillSignal is sent to the child on the first interrupt, giving it a
+	// chance to shut down cleanly before KillTimeout elapses.
+	KillSignal os.Signal
+
+	// KillTimeout is how long to wait for the child to exit after
+	// KillSignal before escalating to SIGKILL.
+	KillTimeout time.Duration
+
+	// PreExitDelay is how long to sleep after KillSignal before escalating
+	// to SIGKILL, giving the child time to drain in-flight work. Ignored
+	// if PreExitCommand is set. The KillTimeout timer runs alongside it, so
+	// a delay longer than KillTimeout is cut short at KillTimeout.
+	PreExitDelay time.Duration
+
+	// PreExitCommand, if set, is run (inheriting the currently rendered
+	// environment) after KillSignal instead of PreExitDelay; envconsul
+	// waits for it to finish, up to KillTimeout, before escalating.
+	PreExitCommand string
+
+	// Format selects how the merged environment is delivered. "exec" (the
+	// default) spawns and re-signals/restarts a child process as before.
+	// "dotenv", "json", and "shell" instead write a snapshot to Output (or
+	// stdout) and never spawn a child.
+	Format string
+
+	// Output is the path the non-exec formats write their snapshot to. An
+	// empty string means stdout.
+	Output string
+
+	// PidFile, for non-exec formats, is read to find the process to send a
+	// prefix's change_signal to, since there is no child to signal
+	// directly.
+	PidFile string
+}
+
+// DefaultConfig returns a Config populated with the default values used
+// when no flag or config file overrides them.
+func DefaultConfig() *Config {
+	return &Config{
+		Auth:        &Authentication{},
+		SSL:         &SSLConfig{Verify: true},
+		Syslog:      &SyslogConfig{},
+		Wait:        &watch.Wait{},
+		Prefixes:    make([]*ConfigPrefix, 0),
+		Vault:       &VaultConfig{SSL: &SSLConfig{Verify: true}},
+		Secrets:     make([]*ConfigSecret, 0),
+		LogLevel:    "warn",
+		KillSignal:  defaultKillSignal,
+		KillTimeout: defaultKillTimeout,
+		Format:      "exec",
+	}
+}
+
+// Copy returns a deep copy of this Config. The nested structs are
+// pointers, so without a deep copy, mutating a merged Config could mutate
+// the original it was derived from.
+func (c *Config) Copy() *Config {
+	if c == nil {
+		return nil
+	}
+
+	n := &Config{
+		Path:           c.Path,
+		Consul:         c.Consul,
+		Token:          c.Token,
+		MaxStale:       c.MaxStale,
+		Retry:          c.Retry,
+		Sanitize:       c.Sanitize,
+		Upcase:         c.Upcase,
+		LogLevel:       c.LogLevel,
+		KillSignal:     c.KillSignal,
+		KillTimeout:    c.KillTimeout,
+		PreExitDelay:   c.PreExitDelay,
+		PreExitCommand: c.PreExitCommand,
+		Format:         c.Format,
+		Output:         c.Output,
+		PidFile:        c.PidFile,
+	}
+
+	if c.Auth != nil {
+		auth := *c.Auth
+		n.Auth = &auth
+	}
+	if c.SSL != nil {
+		ssl := *c.SSL
+		n.SSL = &ssl
+	}
+	if c.Syslog != nil {
+		syslog := *c.Syslog
+		n.Syslog = &syslog
+	}
+	if c.Wait != nil {
+		wait := *c.Wait
+		n.Wait = &wait
+	}
+
+	n.Vault = c.Vault.Copy()
+
+	n.Prefixes = make([]*ConfigPrefix, len(c.Prefixes))
+	copy(n.Prefixes, c.Prefixes)
+
+	n.Secrets = make([]*ConfigSecret, len(c.Secrets))
+	copy(n.Secrets, c.Secrets)
+
+	return n
+}
+
+// Merge returns a new Config with every non-zero-value field of o layered
+// on top of c. Fields that are zero-valued on o (or, for fields that
+// DefaultConfig always fills in, equal to that default) are presumed unset
+// and leave c's value untouched. Callers rely on this to let flags win over a
+// config file: fileConfig.Merge(flagConfig).
+func (c *Config) Merge(o *Config) *Config {
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+	if o.Path != "" {
+		r.Path = o.Path
+	}
+	if o.Consul != "" {
+		r.Consul = o.Consul
+	}
+	if o.Token != "" {
+		r.Token = o.Token
+	}
+	if o.Auth != nil && o.Auth.Enabled {
+		r.Auth = o.Auth
+	}
+	// DefaultConfig always sets SSL to a non-nil {Verify: true}, so "is o.SSL
+	// set" has to mean "differs from that default", not "is non-nil" -
+	// otherwise a flag-derived Config with SSL left untouched would always
+	// win and a config file could never enable SSL or disable verification.
+	if o.SSL != nil && (o.SSL.Enabled || !o.SSL.Verify) {
+		r.SSL = o.SSL
+	}
+	if o.MaxStale != 0 {
+		r.MaxStale = o.MaxStale
+	}
+	if o.Syslog != nil && o.Syslog.Enabled {
+		r.Syslog = o.Syslog
+	}
+	if o.Wait != nil && (o.Wait.Min != 0 || o.Wait.Max != 0) {
+		r.Wait = o.Wait
+	}
+	if o.Retry != 0 {
+		r.Retry = o.Retry
+	}
+	if len(o.Prefixes) > 0 {
+		r.Prefixes = o.Prefixes
+	}
+	if o.Vault != nil {
+		r.Vault = c.Vault.Merge(o.Vault)
+	}
+	if len(o.Secrets) > 0 {
+		r.Secrets = o.Secrets
+	}
+	if o.Sanitize {
+		r.Sanitize = o.Sanitize
+	}
+	if o.Upcase {
+		r.Upcase = o.Upcase
+	}
+	// As with SSL above, DefaultConfig always sets LogLevel, KillSignal,
+	// KillTimeout, and Format, so only a value that differs from that
+	// default counts as set on o; otherwise an untouched flag would always
+	// hide the config file's value.
+	if o.LogLevel != "" && o.LogLevel != "warn" {
+		r.LogLevel = o.LogLevel
+	}
+	if o.KillSignal != nil && o.KillSignal != defaultKillSignal {
+		r.KillSignal = o.KillSignal
+	}
+	if o.KillTimeout != 0 && o.KillTimeout != defaultKillTimeout {
+		r.KillTimeout = o.KillTimeout
+	}
+	if o.PreExitDelay != 0 {
+		r.PreExitDelay = o.PreExitDelay
+	}
+	if o.PreExitCommand != "" {
+		r.PreExitCommand = o.PreExitCommand
+	}
+	if o.Format != "" && o.Format != "exec" {
+		r.Format = o.Format
+	}
+	if o.Output != "" {
+		r.Output = o.Output
+	}
+	if o.PidFile != "" {
+		r.PidFile = o.PidFile
+	}
+
+	return r
+}
+
+// configRequiresRestart reports whether anything the Runner actually
+// watches or acts on differs between oldConfig and newConfig. LogLevel,
+// Syslog, KillSignal, KillTimeout, PreExitDelay, and PreExitCommand are
+// excluded: cli.setup already applies the first two live on every reload,
+// and the rest are only read later, by cli.interrupt, off the *Config the
+// CLI itself is holding - neither needs the Runner torn down and rebuilt.
+func configRequiresRestart(oldConfig, newConfig *Config) bool {
+	o, n := oldConfig.Copy(), newConfig.Copy()
+
+	o.Path, n.Path = "", ""
+	o.LogLevel, n.LogLevel = "", ""
+	o.Syslog, n.Syslog = &SyslogConfig{}, &SyslogConfig{}
+	o.KillSignal, n.KillSignal = nil, nil
+	o.KillTimeout, n.KillTimeout = 0, 0
+	o.PreExitDelay, n.PreExitDelay = 0, 0
+	o.PreExitCommand, n.PreExitCommand = "", ""
+
+	return !reflect.DeepEqual(o, n)
+}
+
+// configFile mirrors the HCL structure of a config file on disk.
+type configFile struct {
+	Consul         string
+	Token          string
+	Auth           string
+	SSL            bool
+	SSLVerify      bool   `hcl:"ssl_verify"`
+	MaxStale       string `hcl:"max_stale"`
+	Syslog         bool
+	SyslogFacility string `hcl:"syslog_facility"`
+	Wait           string
+	Retry          string
+	Sanitize       bool
+	Upcase         bool
+	LogLevel       string `hcl:"log_level"`
+	KillSignal     string `hcl:"kill_signal"`
+	KillTimeout    string `hcl:"kill_timeout"`
+	PreExitDelay   string `hcl:"pre_exit_delay"`
+	PreExitCommand string `hcl:"pre_exit_command"`
+	Format         string
+	Output         string
+	PidFile        string `hcl:"pid_file"`
+}
+
+// ConfigFromPath reads and parses the HCL config file at path into a fresh
+// Config. It returns a Config layered on top of DefaultConfig(); it does
+// not know about any flag-derived overrides, so callers merge a
+// flag-derived Config on top of the result.
+func ConfigFromPath(path string) (*Config, error) {
+	if path == "" {
+		return nil, fmt.Errorf("config: missing path")
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: error reading %q: %s", path, err)
+	}
+
+	obj, err := hcl.Parse(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("config: error parsing %q: %s", path, err)
+	}
+
+	var raw configFile
+	if err := hcl.DecodeObject(&raw, obj); err != nil {
+		return nil, fmt.Errorf("config: error decoding %q: %s", path, err)
+	}
+
+	config := DefaultConfig()
+	config.Path = path
+	config.Consul = raw.Consul
+	config.SSL.Enabled = raw.SSL
+	config.SSL.Verify = raw.SSLVerify
+	config.Syslog.Enabled = raw.Syslog
+	config.Syslog.Facility = raw.SyslogFacility
+	config.Sanitize = raw.Sanitize
+	config.Upcase = raw.Upcase
+	if raw.LogLevel != "" {
+		config.LogLevel = raw.LogLevel
+	}
+	config.Token = raw.Token
+
+	if raw.Auth != "" {
+		auth := new(authVar)
+		if err := auth.Set(raw.Auth); err != nil {
+			return nil, fmt.Errorf("config: error parsing auth: %s", err)
+		}
+		config.Auth = (*Authentication)(auth)
+	}
+
+	if raw.MaxStale != "" {
+		d, err := time.ParseDuration(raw.MaxStale)
+		if err != nil {
+			return nil, fmt.Errorf("config: error parsing max_stale: %s", err)
+		}
+		config.MaxStale = d
+	}
+
+	if raw.Retry != "" {
+		d, err := time.ParseDuration(raw.Retry)
+		if err != nil {
+			return nil, fmt.Errorf("config: error parsing retry: %s", err)
+		}
+		config.Retry = d
+	}
+
+	if raw.KillSignal != "" {
+		sig, err := signals.Parse(raw.KillSignal)
+		if err != nil {
+			return nil, fmt.Errorf("config: error parsing kill_signal: %s", err)
+		}
+		config.KillSignal = sig
+	}
+
+	if raw.KillTimeout != "" {
+		d, err := time.ParseDuration(raw.KillTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("config: error parsing kill_timeout: %s", err)
+		}
+		config.KillTimeout = d
+	}
+
+	if raw.PreExitDelay != "" {
+		d, err := time.ParseDuration(raw.PreExitDelay)
+		if err != nil {
+			return nil, fmt.Errorf("config: error parsing pre_exit_delay: %s", err)
+		}
+		config.PreExitDelay = d
+	}
+
+	config.PreExitCommand = raw.PreExitCommand
+
+	if raw.Format != "" {
+		config.Format = raw.Format
+	}
+	config.Output = raw.Output
+	config.PidFile = raw.PidFile
+
+	if raw.Wait != "" {
+		w, err := watch.ParseWait(raw.Wait)
+		if err != nil {
+			return nil, fmt.Errorf("config: error parsing wait: %s", err)
+		}
+		config.Wait = w
+	}
+
+	prefixes, err := parsePrefixObjects(obj)
+	if err != nil {
+		return nil, err
+	}
+	config.Prefixes = prefixes
+
+	vault, err := parseVaultObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	if vault != nil {
+		config.Vault = vault
+	}
+
+	secrets, err := parseSecretObjects(obj)
+	if err != nil {
+		return nil, err
+	}
+	config.Secrets = secrets
+
+	return config, nil
+}
+
+// parseVaultObject pulls the single `vault { ... }` stanza, if any, out of
+// the parsed HCL object.
+func parseVaultObject(obj *hcl.Object) (*VaultConfig, error) {
+	vaultObj := obj.Get("vault", false)
+	if vaultObj == nil {
+		return nil, nil
+	}
+
+	var raw struct {
+		Address     string
+		Token       string
+		TokenFile   string `hcl:"token_file"`
+		RenewToken  bool   `hcl:"renew_token"`
+		UnwrapToken bool   `hcl:"unwrap_token"`
+		SSL         bool
+		SSLVerify   bool `hcl:"ssl_verify"`
+	}
+	if err := hcl.DecodeObject(&raw, vaultObj); err != nil {
+		return nil, fmt.Errorf("config: error decoding vault: %s", err)
+	}
+
+	return &VaultConfig{
+		Address:     raw.Address,
+		Token:       raw.Token,
+		TokenFile:   raw.TokenFile,
+		RenewToken:  raw.RenewToken,
+		UnwrapToken: raw.UnwrapToken,
+		SSL:         &SSLConfig{Enabled: raw.SSL, Verify: raw.SSLVerify},
+	}, nil
+}
+
+// parseSecretObjects pulls every `secret { ... }` stanza out of the parsed
+// HCL object and turns it into a ConfigSecret.
+func parseSecretObjects(obj *hcl.Object) ([]*ConfigSecret, error) {
+	var secrets []*ConfigSecret
+
+	list := obj.Get("secret", false)
+	if list == nil {
+		return secrets, nil
+	}
+
+	for _, item := range list.Elem(false) {
+		var raw struct {
+			Path string `hcl:",key"`
+		}
+		if err := hcl.DecodeObject(&raw, item); err != nil {
+			return nil, fmt.Errorf("config: error decoding secret: %s", err)
+		}
+
+		sv := new(secretVar)
+		if err := sv.Set(raw.Path); err != nil {
+			return nil, fmt.Errorf("config: error parsing secret %q: %s", raw.Path, err)
+		}
+		secrets = append(secrets, *sv...)
+	}
+
+	return secrets, nil
+}
+
+// parsePrefixObjects pulls every `prefix { ... }` stanza out of the parsed
+// HCL object and turns it into a ConfigPrefix.
+func parsePrefixObjects(obj *hcl.Object) ([]*ConfigPrefix, error) {
+	var prefixes []*ConfigPrefix
+
+	list := obj.Get("prefix", false)
+	if list == nil {
+		return prefixes, nil
+	}
+
+	for _, item := range list.Elem(false) {
+		var raw struct {
+			Path         string `hcl:",key"`
+			ChangeSignal string `hcl:"change_signal"`
+		}
+		if err := hcl.DecodeObject(&raw, item); err != nil {
+			return nil, fmt.Errorf("config: error decoding prefix: %s", err)
+		}
+
+		pv := new(prefixVar)
+		value := raw.Path
+		if raw.ChangeSignal != "" {
+			value = raw.Path + ":" + raw.ChangeSignal
+		}
+		if err := pv.Set(value); err != nil {
+			return nil, fmt.Errorf("config: error parsing prefix %q: %s", raw.Path, err)
+		}
+		prefixes = append(prefixes, *pv...)
+	}
+
+	return prefixes, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestConfig_Copy_isDeep(t *testing.T) {
+	c := DefaultConfig()
+	c.Prefixes = append(c.Prefixes, &ConfigPrefix{})
+
+	n := c.Copy()
+	n.Auth.Enabled = true
+	n.Prefixes[0] = &ConfigPrefix{}
+
+	if c.Auth.Enabled {
+		t.Error("mutating the copy's Auth mutated the original")
+	}
+	if c.Prefixes[0] != nil && c.Prefixes[0] == n.Prefixes[0] {
+		t.Error("mutating the copy's Prefixes slice mutated the original")
+	}
+}
+
+func TestConfig_Merge_flagsWinOverFile(t *testing.T) {
+	fileConfig := DefaultConfig()
+	fileConfig.Consul = "file:8500"
+	fileConfig.LogLevel = "debug"
+
+	flagConfig := DefaultConfig()
+	flagConfig.Consul = "flag:8500"
+
+	merged := fileConfig.Merge(flagConfig)
+
+	if merged.Consul != "flag:8500" {
+		t.Errorf("Consul = %q, want flag value to win", merged.Consul)
+	}
+	if merged.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q, want unset flag field to leave file value untouched", merged.LogLevel)
+	}
+}
+
+func TestConfig_Merge_zeroValuesDoNotOverwrite(t *testing.T) {
+	base := DefaultConfig()
+	base.KillTimeout = 10 * time.Second
+	base.KillSignal = syscall.SIGTERM
+
+	o := DefaultConfig()
+	o.KillTimeout = 0
+	o.KillSignal = nil
+
+	merged := base.Merge(o)
+
+	if merged.KillTimeout != 10*time.Second {
+		t.Errorf("KillTimeout = %s, want zero-valued o field to leave base untouched", merged.KillTimeout)
+	}
+	if merged.KillSignal != syscall.SIGTERM {
+		t.Errorf("KillSignal = %v, want nil o field to leave base untouched", merged.KillSignal)
+	}
+}
+
+func TestVaultConfig_Merge(t *testing.T) {
+	base := &VaultConfig{Address: "base-addr", Token: "base-token"}
+	o := &VaultConfig{Token: "override-token"}
+
+	merged := base.Merge(o)
+
+	if merged.Address != "base-addr" {
+		t.Errorf("Address = %q, want unset o field to leave base untouched", merged.Address)
+	}
+	if merged.Token != "override-token" {
+		t.Errorf("Token = %q, want o's value to win", merged.Token)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Authentication is the HTTP basic authentication data.
+type Authentication struct {
+	Enabled  bool
+	Username string
+	Password string
+}
+
+// authVar implements the flag.Value interface for parsing the -auth flag,
+// which takes the form "user[:pass]".
+type authVar Authentication
+
+func (a *authVar) Set(value string) error {
+	a.Enabled = true
+
+	if strings.Contains(value, ":") {
+		split := strings.SplitN(value, ":", 2)
+		a.Username = split[0]
+		a.Password = split[1]
+	} else {
+		a.Username = value
+	}
+
+	return nil
+}
+
+func (a *authVar) String() string {
+	if a.Password == "" {
+		return a.Username
+	}
+	return fmt.Sprintf("%s:%s", a.Username, a.Password)
+}
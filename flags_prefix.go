@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	dep "github.com/hashicorp/consul-template/dependency"
+	"github.com/hashicorp/consul-template/signals"
+)
+
+// ConfigPrefix is a Consul key prefix to watch, along with any
+// prefix-specific behavior.
+type ConfigPrefix struct {
+	Dependency *dep.StoreKeyPrefix
+
+	// ChangeSignal is sent to the already-running child when this prefix's
+	// data changes, instead of the default full restart. It is parsed once
+	// here, at flag/config-parse time, so the watch hot path never has to
+	// touch the signal string table again.
+	//
+	// nil means "no change_signal was configured" and preserves the
+	// original restart-on-change behavior. signals.SIGNULL means the
+	// prefix is an observer: its updates are merged into the environment
+	// but never signal or restart the child.
+	ChangeSignal os.Signal
+}
+
+// prefixVar implements the flag.Value interface for parsing -prefix flags.
+// Multiple prefixes may be given; they are merged left-to-right with the
+// right-most prefix's values taking precedence. A prefix may optionally be
+// suffixed with ":<signal>" (e.g. "app/config:SIGHUP") to request that
+// updates send <signal> to the child instead of restarting it.
+type prefixVar []*ConfigPrefix
+
+func (pv *prefixVar) Set(value string) error {
+	raw, changeSignalRaw, hasSignal := splitChangeSignal(value)
+
+	d, err := dep.ParseStoreKeyPrefix(raw)
+	if err != nil {
+		return err
+	}
+
+	prefix := &ConfigPrefix{Dependency: d}
+	if hasSignal {
+		sig, err := parseChangeSignal(changeSignalRaw)
+		if err != nil {
+			return err
+		}
+		prefix.ChangeSignal = sig
+	}
+
+	*pv = append(*pv, prefix)
+	return nil
+}
+
+func (pv *prefixVar) String() string {
+	ps := make([]string, len(*pv))
+	for i, p := range *pv {
+		ps[i] = p.Dependency.Key()
+	}
+	return strings.Join(ps, ", ")
+}
+
+// splitChangeSignal splits "path:SIGNAL" into its prefix and signal parts.
+// Colons are valid in Consul KV paths, so the suffix after the last colon
+// is only treated as a change_signal when it actually parses as one
+// (a known signal name, SIGNULL, or empty); otherwise value is assumed to
+// be a bare prefix path that happens to contain a colon, and is returned
+// unsplit.
+func splitChangeSignal(value string) (prefix, signal string, ok bool) {
+	idx := strings.LastIndex(value, ":")
+	if idx == -1 {
+		return value, "", false
+	}
+
+	candidate := value[idx+1:]
+	if _, err := parseChangeSignal(candidate); err != nil {
+		return value, "", false
+	}
+
+	return value[:idx], candidate, true
+}
+
+// parseChangeSignal parses a change_signal value. An empty string or
+// "SIGNULL" both mean "no-op": merge this prefix's data, but never signal
+// or restart the child on its account.
+func parseChangeSignal(raw string) (os.Signal, error) {
+	if raw == "" || raw == "SIGNULL" {
+		return signals.SIGNULL, nil
+	}
+
+	sig, err := signals.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("prefix: invalid change_signal %q: %s", raw, err)
+	}
+	return sig, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul-template/signals"
+)
+
+func TestSplitChangeSignal(t *testing.T) {
+	cases := []struct {
+		name       string
+		value      string
+		wantPrefix string
+		wantSignal string
+		wantOK     bool
+	}{
+		{
+			name:       "no colon",
+			value:      "app/config",
+			wantPrefix: "app/config",
+			wantOK:     false,
+		},
+		{
+			name:       "known signal suffix",
+			value:      "app/config:SIGHUP",
+			wantPrefix: "app/config",
+			wantSignal: "SIGHUP",
+			wantOK:     true,
+		},
+		{
+			name:       "SIGNULL suffix",
+			value:      "app/config:SIGNULL",
+			wantPrefix: "app/config",
+			wantSignal: "SIGNULL",
+			wantOK:     true,
+		},
+		{
+			name:       "colon in key path is not a signal",
+			value:      "app/config:8500",
+			wantPrefix: "app/config:8500",
+			wantOK:     false,
+		},
+		{
+			name:       "multiple colons, only trailing signal recognized",
+			value:      "app:config:SIGTERM",
+			wantPrefix: "app:config",
+			wantSignal: "SIGTERM",
+			wantOK:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			prefix, signal, ok := splitChangeSignal(tc.value)
+			if prefix != tc.wantPrefix || signal != tc.wantSignal || ok != tc.wantOK {
+				t.Errorf("splitChangeSignal(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					tc.value, prefix, signal, ok, tc.wantPrefix, tc.wantSignal, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseChangeSignal(t *testing.T) {
+	if sig, err := parseChangeSignal(""); err != nil || sig != signals.SIGNULL {
+		t.Errorf("parseChangeSignal(\"\") = (%v, %v), want (SIGNULL, nil)", sig, err)
+	}
+	if sig, err := parseChangeSignal("SIGNULL"); err != nil || sig != signals.SIGNULL {
+		t.Errorf("parseChangeSignal(\"SIGNULL\") = (%v, %v), want (SIGNULL, nil)", sig, err)
+	}
+	if _, err := parseChangeSignal("not-a-signal"); err == nil {
+		t.Error("parseChangeSignal(\"not-a-signal\"): expected error, got none")
+	}
+}
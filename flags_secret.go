@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+
+	dep "github.com/hashicorp/consul-template/dependency"
+)
+
+// ConfigSecret is a Vault KV path to watch, merged into the environment on
+// top of every Consul prefix. Unlike ConfigPrefix, secrets do not support a
+// change_signal: a rotated credential should always bounce the child, so
+// any secret update falls through to the normal restart path.
+type ConfigSecret struct {
+	Path       string
+	Dependency dep.Dependency
+}
+
+// secretVar implements the flag.Value interface for parsing -secret flags.
+// Multiple secrets may be given; like prefixes, they are merged
+// left-to-right, but always applied on top of every Consul prefix.
+type secretVar []*ConfigSecret
+
+func (sv *secretVar) Set(value string) error {
+	d, err := dep.NewVaultReadQuery(value)
+	if err != nil {
+		return err
+	}
+
+	*sv = append(*sv, &ConfigSecret{Path: value, Dependency: d})
+	return nil
+}
+
+func (sv *secretVar) String() string {
+	ps := make([]string, len(*sv))
+	for i, s := range *sv {
+		ps[i] = s.Path
+	}
+	return strings.Join(ps, ", ")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+
+	"github.com/hashicorp/consul-template/signals"
+)
+
+// signalVar implements the flag.Value interface for parsing a named signal
+// (e.g. "SIGTERM") into an os.Signal stored at target.
+type signalVar struct {
+	target *os.Signal
+}
+
+func newSignalVar(target *os.Signal) *signalVar {
+	return &signalVar{target: target}
+}
+
+func (s *signalVar) Set(value string) error {
+	sig, err := signals.Parse(value)
+	if err != nil {
+		return err
+	}
+	*s.target = sig
+	return nil
+}
+
+func (s *signalVar) String() string {
+	if s.target == nil || *s.target == nil {
+		return ""
+	}
+	return (*s.target).String()
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+)
+
+// Name is the name of this application.
+const Name = "envconsul"
+
+// Version is the version of this application.
+const Version = "0.7.0"
+
+func main() {
+	os.Exit(realMain())
+}
+
+// realMain runs the CLI and returns an exit code.
+func realMain() int {
+	cli := NewCLI(os.Stdout, os.Stderr)
+	return cli.Run(os.Args)
+}
@@ -0,0 +1,40 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DotenvEncoder writes an environment as a .env file: one KEY=VALUE pair
+// per line, values double-quoted and escaped if they need it.
+type DotenvEncoder struct{}
+
+func (e *DotenvEncoder) Encode(w io.Writer, env map[string]string) error {
+	for _, k := range sortedKeys(env) {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k, quoteIfNeeded(env[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func quoteIfNeeded(v string) string {
+	if v == "" {
+		return v
+	}
+	if !strings.ContainsAny(v, " \t\n\"'$#") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
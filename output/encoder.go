@@ -0,0 +1,27 @@
+// Package output renders a merged environment in one of the non-exec
+// snapshot formats envconsul supports via -format: dotenv, json, and shell.
+package output
+
+import (
+	"fmt"
+	"io"
+)
+
+// Encoder writes the given environment to w in a specific format.
+type Encoder interface {
+	Encode(w io.Writer, env map[string]string) error
+}
+
+// New returns the Encoder registered for the given format name.
+func New(format string) (Encoder, error) {
+	switch format {
+	case "dotenv":
+		return &DotenvEncoder{}, nil
+	case "json":
+		return &JSONEncoder{}, nil
+	case "shell":
+		return &ShellEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("output: unknown format %q", format)
+	}
+}
@@ -0,0 +1,83 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		format  string
+		wantErr bool
+	}{
+		{"dotenv", false},
+		{"json", false},
+		{"shell", false},
+		{"exec", true},
+		{"", true},
+	}
+
+	for _, tc := range cases {
+		enc, err := New(tc.format)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("New(%q): expected error, got none", tc.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(%q): unexpected error: %s", tc.format, err)
+		}
+		if enc == nil {
+			t.Errorf("New(%q): expected a non-nil Encoder", tc.format)
+		}
+	}
+}
+
+func TestDotenvEncoder_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	env := map[string]string{
+		"PLAIN": "value",
+		"QUOTE": `has "quotes" and spaces`,
+	}
+
+	if err := (&DotenvEncoder{}).Encode(&buf, env); err != nil {
+		t.Fatalf("Encode: %s", err)
+	}
+
+	want := "PLAIN=value\n" + `QUOTE="has \"quotes\" and spaces"` + "\n"
+	if buf.String() != want {
+		t.Errorf("Encode output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestJSONEncoder_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	env := map[string]string{"KEY": "value"}
+
+	if err := (&JSONEncoder{}).Encode(&buf, env); err != nil {
+		t.Fatalf("Encode: %s", err)
+	}
+
+	want := "{\n  \"KEY\": \"value\"\n}\n"
+	if buf.String() != want {
+		t.Errorf("Encode output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestShellEncoder_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	env := map[string]string{
+		"PLAIN": `C:\path`,
+		"QUOTE": "it's here",
+	}
+
+	if err := (&ShellEncoder{}).Encode(&buf, env); err != nil {
+		t.Fatalf("Encode: %s", err)
+	}
+
+	want := "export PLAIN='C:\\path'\nexport QUOTE='it'\\''s here'\n"
+	if buf.String() != want {
+		t.Errorf("Encode output = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,16 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONEncoder writes an environment as a JSON object of string keys to
+// string values.
+type JSONEncoder struct{}
+
+func (e *JSONEncoder) Encode(w io.Writer, env map[string]string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(env)
+}
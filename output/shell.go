@@ -0,0 +1,21 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ShellEncoder writes an environment as shell `export` statements, suitable
+// for `source`-ing into a running shell.
+type ShellEncoder struct{}
+
+func (e *ShellEncoder) Encode(w io.Writer, env map[string]string) error {
+	for _, k := range sortedKeys(env) {
+		v := strings.ReplaceAll(env[k], `'`, `'\''`)
+		if _, err := fmt.Fprintf(w, "export %s='%s'\n", k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
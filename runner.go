@@ -0,0 +1,524 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-template/signals"
+	"github.com/hashicorp/consul-template/watch"
+	"github.com/navinrio/envconsul/output"
+)
+
+// Runner is responsible for watching the configured Consul prefixes,
+// merging the resulting key/value pairs into an environment, and
+// running/managing the child process with that environment.
+type Runner struct {
+	config  *Config
+	command []string
+	once    bool
+
+	watcher *watch.Watcher
+
+	// dataMu guards data and secretData, since Start's watch loop writes
+	// them on its own goroutine while a pre-exit hook running concurrently
+	// (kicked off by CLI.interrupt) reads them through mergedEnv/
+	// mergedEnvMap on a second goroutine.
+	dataMu sync.Mutex
+
+	// data is the merged set of environment variables, keyed by the
+	// ConfigPrefix that produced it so updates can be re-merged
+	// left-to-right in prefix order.
+	data map[*ConfigPrefix]map[string]string
+
+	// secretData is the same, but for Vault secrets. Secrets are applied on
+	// top of every prefix's data, so operators can override a Consul value
+	// with a Vault secret.
+	secretData map[*ConfigSecret]map[string]string
+
+	// child is the currently running subprocess, if any.
+	child *exec.Cmd
+
+	// ErrCh is where the runner reports unrecoverable errors.
+	ErrCh chan error
+
+	// DoneCh is closed when the runner has no more work to do (-once).
+	DoneCh chan struct{}
+
+	// ExitCh receives the exit code of the child process when it exits on
+	// its own.
+	ExitCh chan int
+}
+
+// NewRunner creates a new Runner for the given config, ready to be started.
+func NewRunner(config *Config, command []string, once bool) (*Runner, error) {
+	runner := &Runner{
+		config:     config,
+		command:    command,
+		once:       once,
+		data:       make(map[*ConfigPrefix]map[string]string),
+		secretData: make(map[*ConfigSecret]map[string]string),
+		ErrCh:      make(chan error),
+		DoneCh:     make(chan struct{}),
+		ExitCh:     make(chan int),
+	}
+
+	watcher, err := newWatcher(config)
+	if err != nil {
+		return nil, err
+	}
+	runner.watcher = watcher
+
+	return runner, nil
+}
+
+// newWatcher builds the consul-template watcher used to observe every
+// configured prefix.
+func newWatcher(config *Config) (*watch.Watcher, error) {
+	vaultToken := config.Vault.Token
+	if vaultToken == "" && config.Vault.TokenFile != "" {
+		contents, err := ioutil.ReadFile(config.Vault.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("runner: error reading vault token file: %s", err)
+		}
+		vaultToken = strings.TrimSpace(string(contents))
+	}
+
+	clientConfig := &watch.ClientConfig{
+		Consul:     config.Consul,
+		Token:      config.Token,
+		MaxStale:   config.MaxStale,
+		SSLEnabled: config.SSL.Enabled,
+		SSLVerify:  config.SSL.Verify,
+
+		VaultAddress:     config.Vault.Address,
+		VaultToken:       vaultToken,
+		VaultSSLEnabled:  config.Vault.SSL.Enabled,
+		VaultSSLVerify:   config.Vault.SSL.Verify,
+		VaultUnwrapToken: config.Vault.UnwrapToken,
+	}
+	if config.Auth.Enabled {
+		clientConfig.Auth.Enabled = true
+		clientConfig.Auth.Username = config.Auth.Username
+		clientConfig.Auth.Password = config.Auth.Password
+	}
+
+	return watch.NewWatcher(&watch.WatcherConfig{
+		Client:          clientConfig,
+		Once:            false,
+		MaxStale:        config.MaxStale,
+		Wait:            config.Wait,
+		Retry:           config.Retry,
+		VaultRenewToken: config.Vault.RenewToken,
+	})
+}
+
+// Start begins watching every configured prefix and secret. Each time their
+// data changes, the full environment is re-merged and handed to update,
+// which restarts or signals the child process (or, for a non-exec -format,
+// rewrites the snapshot).
+func (r *Runner) Start() {
+	log.Printf("[INFO] (runner) starting")
+
+	for _, prefix := range r.config.Prefixes {
+		r.watcher.Add(prefix.Dependency)
+	}
+	for _, secret := range r.config.Secrets {
+		r.watcher.Add(secret.Dependency)
+	}
+
+	for {
+		select {
+		case view := <-r.watcher.DataCh():
+			updated, secretsChanged := r.applyView(view)
+
+			// Drain any other updates that arrived in the same instant so
+			// a batch of prefixes that all fired together is judged as one
+			// unit (all-change_signal vs. any-restart), not one at a time.
+		drain:
+			for {
+				select {
+				case view := <-r.watcher.DataCh():
+					u, sc := r.applyView(view)
+					updated = append(updated, u...)
+					secretsChanged = secretsChanged || sc
+				default:
+					break drain
+				}
+			}
+
+			if !r.watcher.Watching(r.allDependencies()...) {
+				// still waiting on the rest of the prefixes/secrets to
+				// report in
+				continue
+			}
+
+			if err := r.update(updated, secretsChanged); err != nil {
+				r.ErrCh <- err
+				return
+			}
+
+			if r.once {
+				close(r.DoneCh)
+				return
+			}
+		case err := <-r.watcher.ErrCh():
+			r.ErrCh <- err
+			return
+		}
+	}
+}
+
+// applyView merges a single watch.View's data into r.data or r.secretData
+// and reports which ConfigPrefixes changed (for change_signal bookkeeping)
+// and whether any Vault secret changed (which always forces a restart).
+func (r *Runner) applyView(view watch.View) ([]*ConfigPrefix, bool) {
+	if prefix := r.prefixForDependency(view.Dependency()); prefix != nil {
+		env := dataToEnv(view.Data(), r.config.Sanitize, r.config.Upcase)
+		r.dataMu.Lock()
+		r.data[prefix] = env
+		r.dataMu.Unlock()
+		return []*ConfigPrefix{prefix}, false
+	}
+
+	if secret := r.secretForDependency(view.Dependency()); secret != nil {
+		env := dataToEnv(view.Data(), r.config.Sanitize, r.config.Upcase)
+		r.dataMu.Lock()
+		r.secretData[secret] = env
+		r.dataMu.Unlock()
+		return nil, true
+	}
+
+	return nil, false
+}
+
+// update reacts to the given set of prefixes (and whether any secret) has
+// received new data.
+//
+// If the child hasn't been started yet, any Vault secret changed, or any
+// updated prefix has no ChangeSignal configured, the child is fully
+// restarted with the newly merged environment - this is the original,
+// pre-change_signal behavior, and secrets never opt out of it since a
+// rotated credential should always bounce the child. Otherwise, every
+// updated prefix's ChangeSignal is sent to the already-running child
+// (skipping signals.SIGNULL no-op prefixes, which only want their data
+// merged, not acted on).
+func (r *Runner) update(updated []*ConfigPrefix, secretsChanged bool) error {
+	if r.config.Format != "" && r.config.Format != "exec" {
+		return r.updateOutput(updated)
+	}
+
+	if r.child == nil || secretsChanged {
+		return r.restart()
+	}
+
+	for _, prefix := range updated {
+		if prefix.ChangeSignal == nil {
+			return r.restart()
+		}
+	}
+
+	for _, prefix := range updated {
+		if prefix.ChangeSignal == signals.SIGNULL {
+			continue
+		}
+		if err := r.Signal(prefix.ChangeSignal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateOutput handles a data change when a non-exec -format is in use: no
+// child is ever spawned. The merged environment is (re)written to
+// config.Output (or stdout), and if any updated prefix carries a
+// change_signal, it is sent to the PID found in config.PidFile instead of
+// a child process, since there is no child to signal directly.
+func (r *Runner) updateOutput(updated []*ConfigPrefix) error {
+	if err := r.writeOutput(); err != nil {
+		return err
+	}
+
+	if r.config.PidFile == "" {
+		return nil
+	}
+
+	for _, prefix := range updated {
+		if prefix.ChangeSignal == nil || prefix.ChangeSignal == signals.SIGNULL {
+			continue
+		}
+		if err := r.signalPidFile(prefix.ChangeSignal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeOutput renders the merged environment with the encoder for
+// config.Format and writes it atomically to config.Output (or stdout, if
+// unset).
+func (r *Runner) writeOutput() error {
+	enc, err := output.New(r.config.Format)
+	if err != nil {
+		return err
+	}
+
+	if r.config.Output == "" {
+		return enc.Encode(os.Stdout, r.mergedEnvMap())
+	}
+
+	dir := filepath.Dir(r.config.Output)
+	tmp, err := ioutil.TempFile(dir, ".envconsul")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := enc.Encode(tmp, r.mergedEnvMap()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), r.config.Output)
+}
+
+// signalPidFile reads a PID from config.PidFile and sends it sig. It is the
+// non-exec formats' equivalent of Signal(), used because there is no child
+// process to hold a reference to.
+func (r *Runner) signalPidFile(sig os.Signal) error {
+	contents, err := ioutil.ReadFile(r.config.PidFile)
+	if err != nil {
+		return err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return fmt.Errorf("runner: invalid pid_file contents: %s", err)
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
+
+// restart merges the currently known environment and spawns a fresh child
+// process, killing any child that is already running.
+func (r *Runner) restart() error {
+	r.stopChild()
+
+	env := r.mergedEnv()
+
+	cmd := exec.Command(r.command[0], r.command[1:]...)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	r.child = cmd
+
+	go func() {
+		err := cmd.Wait()
+		if err == nil {
+			r.ExitCh <- ExitCodeOK
+			return
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			r.ExitCh <- exitErr.ExitCode()
+			return
+		}
+		r.ErrCh <- err
+	}()
+
+	return nil
+}
+
+// mergedEnvMap returns the environment pairs rendered from Consul prefixes
+// and Vault secrets, with secrets taking precedence over prefixes on key
+// collision. It does not include the parent process's own environment.
+func (r *Runner) mergedEnvMap() map[string]string {
+	merged := make(map[string]string)
+
+	r.dataMu.Lock()
+	defer r.dataMu.Unlock()
+
+	for _, prefix := range r.config.Prefixes {
+		for k, v := range r.data[prefix] {
+			merged[k] = v
+		}
+	}
+	for _, secret := range r.config.Secrets {
+		for k, v := range r.secretData[secret] {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
+
+// mergedEnv merges every prefix's and secret's key/value data into a single
+// slice of "KEY=VALUE" strings. Consul prefixes are applied left-to-right
+// first, then Vault secrets are applied left-to-right on top, so operators
+// can override a Consul value with a Vault secret. The current process
+// environment sits underneath all of it.
+func (r *Runner) mergedEnv() []string {
+	env := os.Environ()
+	for k, v := range r.mergedEnvMap() {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// PreExit runs the configured pre-exit hook, meant to be called after
+// KillSignal has already been sent to the child and before it is
+// force-killed. If config.PreExitCommand is set, it is run to completion
+// (up to config.KillTimeout); otherwise envconsul simply sleeps
+// config.PreExitDelay. This gives a child that drains in-flight work on
+// its own signal time to do so while envconsul keeps it alive.
+func (r *Runner) PreExit(config *Config) error {
+	if config.PreExitCommand != "" {
+		return r.runPreExitCommand(config)
+	}
+	if config.PreExitDelay > 0 {
+		time.Sleep(config.PreExitDelay)
+	}
+	return nil
+}
+
+// runPreExitCommand runs config.PreExitCommand using the same child
+// machinery as the main subprocess, so its stdout/stderr are captured, and
+// inheriting the currently rendered environment. It has its own timeout,
+// independent of the main child's.
+func (r *Runner) runPreExitCommand(config *Config) error {
+	args := strings.Fields(config.PreExitCommand)
+	if len(args) == 0 {
+		return nil
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = r.mergedEnv()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("runner: error starting pre_exit_command: %s", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(config.KillTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("runner: pre_exit_command timed out after %s", config.KillTimeout)
+	}
+}
+
+// Stop halts the watcher and any running child process.
+func (r *Runner) Stop() {
+	log.Printf("[INFO] (runner) stopping")
+
+	if r.watcher != nil {
+		r.watcher.Stop()
+	}
+	r.stopChild()
+}
+
+// Signal sends the given signal to the child process, if one is running.
+func (r *Runner) Signal(s os.Signal) error {
+	if r.child == nil || r.child.Process == nil {
+		return nil
+	}
+	return r.child.Process.Signal(s)
+}
+
+func (r *Runner) stopChild() {
+	if r.child != nil && r.child.Process != nil {
+		r.child.Process.Kill()
+	}
+	r.child = nil
+}
+
+func (r *Runner) prefixForDependency(d watch.Dependency) *ConfigPrefix {
+	for _, prefix := range r.config.Prefixes {
+		if prefix.Dependency.HashCode() == d.HashCode() {
+			return prefix
+		}
+	}
+	return nil
+}
+
+func (r *Runner) secretForDependency(d watch.Dependency) *ConfigSecret {
+	for _, secret := range r.config.Secrets {
+		if secret.Dependency.HashCode() == d.HashCode() {
+			return secret
+		}
+	}
+	return nil
+}
+
+func (r *Runner) allDependencies() []watch.Dependency {
+	deps := make([]watch.Dependency, 0, len(r.config.Prefixes)+len(r.config.Secrets))
+	for _, prefix := range r.config.Prefixes {
+		deps = append(deps, prefix.Dependency)
+	}
+	for _, secret := range r.config.Secrets {
+		deps = append(deps, secret.Dependency)
+	}
+	return deps
+}
+
+// dataToEnv converts a prefix's raw key/value pairs into environment
+// variables, optionally sanitizing invalid characters in keys to
+// underscores and upcasing every key.
+func dataToEnv(data map[string]string, sanitize, upcase bool) map[string]string {
+	env := make(map[string]string, len(data))
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := k
+		if sanitize {
+			key = sanitizeKey(key)
+		}
+		if upcase {
+			key = strings.ToUpper(key)
+		}
+		env[key] = data[k]
+	}
+
+	return env
+}
+
+func sanitizeKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
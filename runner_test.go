@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunner_mergedEnvMap_vaultOverridesConsul(t *testing.T) {
+	prefix := &ConfigPrefix{}
+	secret := &ConfigSecret{Path: "secret/app"}
+
+	r := &Runner{
+		config: &Config{
+			Prefixes: []*ConfigPrefix{prefix},
+			Secrets:  []*ConfigSecret{secret},
+		},
+		data: map[*ConfigPrefix]map[string]string{
+			prefix: {"SHARED_KEY": "from-consul", "CONSUL_ONLY": "consul-value"},
+		},
+		secretData: map[*ConfigSecret]map[string]string{
+			secret: {"SHARED_KEY": "from-vault", "VAULT_ONLY": "vault-value"},
+		},
+	}
+
+	got := r.mergedEnvMap()
+	want := map[string]string{
+		"SHARED_KEY":  "from-vault",
+		"CONSUL_ONLY": "consul-value",
+		"VAULT_ONLY":  "vault-value",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergedEnvMap() = %#v, want %#v", got, want)
+	}
+}
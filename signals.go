@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals is the list of signals the CLI's signal loop subscribes to. SIGHUP
+// triggers a configuration reload; the rest start a graceful shutdown that
+// sends the configured kill signal to the child process before envconsul
+// itself exits.
+var Signals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+}